@@ -0,0 +1,184 @@
+package upspinfsys_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rschio/upspinfsys"
+	"github.com/rschio/upspinfsys/upspintest"
+	"upspin.io/config"
+	uerrors "upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+const (
+	accessOwner = "user@example.com"
+	accessBob   = "bob@example.com"
+)
+
+func newAccessTestClient() upspin.Client {
+	return upspintest.NewClient(map[string]upspintest.File{
+		accessOwner + "/documents/Access":  {Data: []byte("Read,List: " + accessBob + "\n")},
+		accessOwner + "/documents/doc.txt": {Data: []byte("shared")},
+		accessOwner + "/private/doc.txt":   {Data: []byte("not shared")},
+	})
+}
+
+func TestModeForAccess(t *testing.T) {
+	client := newAccessTestClient()
+
+	cases := []struct {
+		name string
+		user upspin.UserName
+		path string
+		want fs.FileMode
+	}{
+		{"owner has full rights everywhere", accessOwner, accessOwner + "/private/doc.txt", 0700},
+		{"grantee gets only the rights Access grants", accessBob, accessOwner + "/documents/doc.txt", 0500},
+		{"grantee has no rights outside the Access file's reach", accessBob, accessOwner + "/private/doc.txt", 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := config.SetUserName(config.New(), c.user)
+			fsys := upspinfsys.UpspinFS(client, upspinfsys.WithAccess(cfg))
+
+			fi, err := fs.Stat(fsys, c.path)
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			if got := fi.Mode().Perm(); got != c.want {
+				t.Fatalf("got mode %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestModeForWithoutAccessOption(t *testing.T) {
+	client := newAccessTestClient()
+	fsys := upspinfsys.UpspinFS(client)
+
+	fi, err := fs.Stat(fsys, accessOwner+"/private/doc.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if got := fi.Mode().Perm(); got != 0700 {
+		t.Fatalf("got mode %v, want the permissive 0700 default", got)
+	}
+}
+
+func TestSubForUser(t *testing.T) {
+	client := newAccessTestClient()
+	fsys, err := upspinfsys.SubForUser(upspinfsys.UpspinFS(client), accessOwner)
+	if err != nil {
+		t.Fatalf("SubForUser: %v", err)
+	}
+	if err := fstest.TestFS(fsys, "documents", "documents/doc.txt", "private", "private/doc.txt"); err != nil {
+		t.Fatalf("fstest: %v", err)
+	}
+}
+
+// globDenyClient wraps an upspin.Client and denies a single Glob pattern with
+// a Permission error, simulating a DirServer refusing to list a directory
+// the caller has no rights to.
+type globDenyClient struct {
+	upspin.Client
+	deny string
+}
+
+func (c globDenyClient) Glob(pattern string) ([]*upspin.DirEntry, error) {
+	if pattern == c.deny {
+		return nil, uerrors.E(uerrors.Permission, upspin.PathName(pattern))
+	}
+	return c.Client.Glob(pattern)
+}
+
+func TestReadDirPermissionDenied(t *testing.T) {
+	base := newAccessTestClient()
+	pattern := accessOwner + "/private/*"
+	client := globDenyClient{Client: base, deny: pattern}
+	fsys := upspinfsys.UpspinFS(client)
+
+	_, err := fs.ReadDir(fsys, accessOwner+"/private")
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Fatalf("ReadDir error = %v, want fs.ErrPermission", err)
+	}
+}
+
+// createDenyClient, mkdirDenyClient, and deleteDenyClient each wrap an
+// upspin.Client and deny a single path with a Permission error, simulating a
+// DirServer refusing a write the caller's Access rights don't cover. Real
+// DirServers enforce Access themselves; WriteFS's job is only to surface
+// that denial as fs.ErrPermission instead of losing it in a generic wrapped
+// error, which is what these tests check.
+type createDenyClient struct {
+	upspin.Client
+	deny upspin.PathName
+}
+
+func (c createDenyClient) Create(name upspin.PathName) (upspin.File, error) {
+	if name == c.deny {
+		return nil, uerrors.E(uerrors.Permission, name)
+	}
+	return c.Client.Create(name)
+}
+
+type mkdirDenyClient struct {
+	upspin.Client
+	deny upspin.PathName
+}
+
+func (c mkdirDenyClient) MakeDirectory(dirName upspin.PathName) (*upspin.DirEntry, error) {
+	if dirName == c.deny {
+		return nil, uerrors.E(uerrors.Permission, dirName)
+	}
+	return c.Client.MakeDirectory(dirName)
+}
+
+type deleteDenyClient struct {
+	upspin.Client
+	deny upspin.PathName
+}
+
+func (c deleteDenyClient) Delete(name upspin.PathName) error {
+	if name == c.deny {
+		return uerrors.E(uerrors.Permission, name)
+	}
+	return c.Client.Delete(name)
+}
+
+func TestWriteOpsPermissionDenied(t *testing.T) {
+	base := newAccessTestClient()
+
+	t.Run("create", func(t *testing.T) {
+		name := upspin.PathName(accessOwner + "/documents/new.txt")
+		wfs := upspinfsys.UpspinWriteFS(createDenyClient{Client: base, deny: name})
+
+		f, err := wfs.Create(string(name))
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := f.Close(); !errors.Is(err, fs.ErrPermission) {
+			t.Fatalf("Close error = %v, want fs.ErrPermission", err)
+		}
+	})
+
+	t.Run("mkdir", func(t *testing.T) {
+		name := upspin.PathName(accessOwner + "/newdir")
+		wfs := upspinfsys.UpspinWriteFS(mkdirDenyClient{Client: base, deny: name})
+
+		if err := wfs.Mkdir(string(name), 0755); !errors.Is(err, fs.ErrPermission) {
+			t.Fatalf("Mkdir error = %v, want fs.ErrPermission", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		name := upspin.PathName(accessOwner + "/documents/doc.txt")
+		wfs := upspinfsys.UpspinWriteFS(deleteDenyClient{Client: base, deny: name})
+
+		if err := wfs.Remove(string(name)); !errors.Is(err, fs.ErrPermission) {
+			t.Fatalf("Remove error = %v, want fs.ErrPermission", err)
+		}
+	})
+}
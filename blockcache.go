@@ -0,0 +1,289 @@
+package upspinfsys
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+
+	"upspin.io/upspin"
+)
+
+// prefetchBlocks is how many blocks ahead a blockCache fetches in the
+// background once it detects sequential access to a file.
+const prefetchBlocks = 4
+
+// Stats reports a blockCache's hit, miss, and eviction counters.
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+// blockCache is an LRU cache of fixed-size blocks shared by every cachedFile
+// reading through the uFS it belongs to. Blocks are keyed by the DirEntry
+// they came from and its Sequence, so a Put that bumps a file's Sequence
+// makes its old blocks unreachable rather than serving stale data;
+// purgeLocked reclaims them instead of waiting for them to age out of the LRU.
+type blockCache struct {
+	blockSize int64
+	capacity  int
+
+	mu        sync.Mutex
+	order     *list.List
+	index     map[blockKey]*list.Element
+	sequence  map[upspin.PathName]int64 // newest Sequence seen per file
+	lastBlock map[upspin.PathName]int64 // last block index read per file
+
+	hits, misses, evictions atomic.Int64
+}
+
+type blockKey struct {
+	name     upspin.PathName
+	sequence int64
+	block    int64
+}
+
+type cacheEntry struct {
+	key  blockKey
+	data []byte
+}
+
+func newBlockCache(capacity int, blockSize int64) *blockCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if blockSize < 1 {
+		blockSize = 64 << 10
+	}
+	return &blockCache{
+		blockSize: blockSize,
+		capacity:  capacity,
+		order:     list.New(),
+		index:     make(map[blockKey]*list.Element),
+		sequence:  make(map[upspin.PathName]int64),
+		lastBlock: make(map[upspin.PathName]int64),
+	}
+}
+
+// Stats returns a snapshot of the cache's counters.
+func (c *blockCache) Stats() Stats {
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+}
+
+// fetchFunc reads the block at the given index, trimmed to less than
+// blockSize bytes only at EOF.
+type fetchFunc func(block int64) ([]byte, error)
+
+// get returns the cached contents of de's block, fetching and caching it on
+// a miss. It also detects sequential access to de.Name and reports that back
+// to the caller as sequential, so the caller can kick off a background
+// prefetch of the following blocks. get itself never starts that goroutine:
+// the cachedFile calling it owns prefetch lifecycle, since it's the one that
+// must join the goroutine before its upspin.File is closed.
+func (c *blockCache) get(de *upspin.DirEntry, block int64, fetch fetchFunc) (data []byte, sequential bool, err error) {
+	c.mu.Lock()
+	if old, ok := c.sequence[de.Name]; ok && old != de.Sequence {
+		c.purgeLocked(de.Name, old)
+	}
+	c.sequence[de.Name] = de.Sequence
+	key := blockKey{name: de.Name, sequence: de.Sequence, block: block}
+
+	if el, ok := c.index[key]; ok {
+		c.order.MoveToFront(el)
+		data := el.Value.(*cacheEntry).data
+		sequential := c.noteAccessLocked(de.Name, block)
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return data, sequential, nil
+	}
+	sequential = c.noteAccessLocked(de.Name, block)
+	c.mu.Unlock()
+
+	c.misses.Add(1)
+	data, err = fetch(block)
+	if err != nil {
+		return nil, false, err
+	}
+	c.put(key, data)
+	return data, sequential, nil
+}
+
+// noteAccessLocked records that block was just read from name and reports
+// whether it immediately follows the previously read block, i.e. whether
+// access looks sequential. The caller must hold c.mu.
+func (c *blockCache) noteAccessLocked(name upspin.PathName, block int64) bool {
+	prev, ok := c.lastBlock[name]
+	c.lastBlock[name] = block
+	return ok && block == prev+1
+}
+
+// prefetch fetches and caches the next prefetchBlocks blocks of de, stopping
+// early on error or after a short block, which marks EOF. Callers run it in
+// its own goroutine, so errors are simply dropped: a real read of the same
+// block will surface them.
+func (c *blockCache) prefetch(de *upspin.DirEntry, start int64, fetch fetchFunc) {
+	for i := int64(0); i < prefetchBlocks; i++ {
+		block := start + i
+		key := blockKey{name: de.Name, sequence: de.Sequence, block: block}
+
+		c.mu.Lock()
+		_, cached := c.index[key]
+		c.mu.Unlock()
+		if cached {
+			continue
+		}
+
+		data, err := fetch(block)
+		if err != nil {
+			return
+		}
+		c.put(key, data)
+		if int64(len(data)) < c.blockSize {
+			return // short block: reached EOF.
+		}
+	}
+}
+
+func (c *blockCache) put(key blockKey, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.index[key]; ok {
+		el.Value.(*cacheEntry).data = data
+		c.order.MoveToFront(el)
+		return
+	}
+	c.index[key] = c.order.PushFront(&cacheEntry{key: key, data: data})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.index, oldest.Value.(*cacheEntry).key)
+		c.evictions.Add(1)
+	}
+}
+
+// purgeLocked removes every cached block of name at sequence seq. The
+// caller must hold c.mu.
+func (c *blockCache) purgeLocked(name upspin.PathName, seq int64) {
+	for key, el := range c.index {
+		if key.name == name && key.sequence == seq {
+			c.order.Remove(el)
+			delete(c.index, key)
+		}
+	}
+}
+
+// cachedFile wraps an upspin.File with a blockCache, used by uFS.Open when
+// the fs.FS was created with WithBlockCache.
+//
+// A cachedFile's foreground ReadAt calls and the background goroutine its
+// own sequential-access detection spawns both end up calling file.ReadAt, so
+// fileMu serializes them: upspin.File implementations are not guaranteed
+// safe for concurrent use. wg tracks any prefetch goroutine still running so
+// Close can join it instead of closing file out from under it.
+type cachedFile struct {
+	file  upspin.File
+	de    *upspin.DirEntry
+	cache *blockCache
+	u     uFS
+
+	pos int64
+
+	fileMu sync.Mutex
+	wg     sync.WaitGroup
+}
+
+func (f *cachedFile) Close() error {
+	f.wg.Wait()
+	return f.file.Close()
+}
+
+func (f *cachedFile) Stat() (fs.FileInfo, error) {
+	return f.u.fileInfo(f.de), nil
+}
+
+func (f *cachedFile) Read(b []byte) (int, error) {
+	n, err := f.ReadAt(b, f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *cachedFile) Seek(offset int64, whence int) (int64, error) {
+	size, _ := f.de.Size()
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = f.pos + offset
+	case io.SeekEnd:
+		abs = size + offset
+	default:
+		return 0, fmt.Errorf("cachedFile.Seek: invalid whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("cachedFile.Seek: negative position")
+	}
+	f.pos = abs
+	return abs, nil
+}
+
+// ReadAt reads through f.cache, fetching whole blocks from f.file on a
+// cache miss.
+func (f *cachedFile) ReadAt(b []byte, off int64) (int, error) {
+	blockSize := f.cache.blockSize
+	fetch := func(block int64) ([]byte, error) {
+		buf := make([]byte, blockSize)
+		f.fileMu.Lock()
+		n, err := f.file.ReadAt(buf, block*blockSize)
+		f.fileMu.Unlock()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	var total int
+	for total < len(b) {
+		pos := off + int64(total)
+		block := pos / blockSize
+		blockStart := block * blockSize
+
+		data, sequential, err := f.cache.get(f.de, block, fetch)
+		if err != nil {
+			if total > 0 {
+				return total, nil
+			}
+			return 0, err
+		}
+		if sequential {
+			f.wg.Add(1)
+			go func(start int64) {
+				defer f.wg.Done()
+				f.cache.prefetch(f.de, start, fetch)
+			}(block + 1)
+		}
+
+		skip := pos - blockStart
+		if skip >= int64(len(data)) {
+			break // Requested offset is at or past EOF.
+		}
+		n := copy(b[total:], data[skip:])
+		total += n
+		if int64(len(data)) < blockSize {
+			break // Short block: reached EOF.
+		}
+	}
+
+	if total < len(b) {
+		return total, io.EOF
+	}
+	return total, nil
+}
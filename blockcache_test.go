@@ -0,0 +1,104 @@
+package upspinfsys_test
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+
+	"github.com/rschio/upspinfsys"
+	"github.com/rschio/upspinfsys/upspintest"
+)
+
+func TestBlockCache(t *testing.T) {
+	const name = "user@example.com/big.txt"
+	data := bytes.Repeat([]byte("0123456789"), 1000) // 10000 bytes.
+
+	client := upspintest.NewClient(map[string]upspintest.File{
+		name: {Data: data},
+	})
+	fsys := upspinfsys.UpspinFS(client, upspinfsys.WithBlockCache(16, 1024))
+
+	got, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(data))
+	}
+
+	before, ok := upspinfsys.CacheStats(fsys)
+	if !ok {
+		t.Fatal("CacheStats: expected a cache")
+	}
+	if before.Misses == 0 {
+		t.Fatalf("expected at least one miss on first read, got %+v", before)
+	}
+
+	if _, err := fs.ReadFile(fsys, name); err != nil {
+		t.Fatalf("second ReadFile: %v", err)
+	}
+	after, _ := upspinfsys.CacheStats(fsys)
+	if after.Hits <= before.Hits {
+		t.Fatalf("expected more hits on second read, before %+v after %+v", before, after)
+	}
+}
+
+func TestBlockCacheInvalidatesOnWrite(t *testing.T) {
+	const name = "user@example.com/f.txt"
+	client := upspintest.NewClient(map[string]upspintest.File{
+		name: {Data: []byte("version one")},
+	})
+	fsys := upspinfsys.UpspinFS(client, upspinfsys.WithBlockCache(16, 4))
+
+	if _, err := fs.ReadFile(fsys, name); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	if _, err := client.Put(name, []byte("version two, longer")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	got, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		t.Fatalf("ReadFile after write: %v", err)
+	}
+	if string(got) != "version two, longer" {
+		t.Fatalf("got %q, want %q", got, "version two, longer")
+	}
+}
+
+// TestBlockCachePrefetchRace guards against a data race between a
+// cachedFile's foreground reads and the background prefetch goroutine they
+// spawn: both call ReadAt on the same underlying upspin.File, which isn't
+// guaranteed safe for concurrent use. Run with -race to be meaningful.
+func TestBlockCachePrefetchRace(t *testing.T) {
+	const name = "user@example.com/big.txt"
+	data := bytes.Repeat([]byte("0123456789"), 100000) // 1,000,000 bytes.
+
+	client := upspintest.NewClient(map[string]upspintest.File{
+		name: {Data: data},
+	})
+	// A small block size relative to the data keeps many prefetches in
+	// flight while the foreground reader is still working through blocks.
+	fsys := upspinfsys.UpspinFS(client, upspinfsys.WithBlockCache(64, 8))
+
+	got, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestNoBlockCacheByDefault(t *testing.T) {
+	const name = "user@example.com/f.txt"
+	client := upspintest.NewClient(map[string]upspintest.File{
+		name: {Data: []byte("hello")},
+	})
+	fsys := upspinfsys.UpspinFS(client)
+
+	if _, ok := upspinfsys.CacheStats(fsys); ok {
+		t.Fatal("CacheStats: expected no cache without WithBlockCache")
+	}
+}
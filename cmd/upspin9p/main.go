@@ -0,0 +1,119 @@
+// Upspin9p serves one or more Upspin user trees over 9P2000.L using the
+// upspin9p package, so that any 9P client (including the Linux kernel's own
+// v9fs) can read Upspin content without distributing Upspin keys to the
+// consumer. The connection itself, not Upspin, is responsible for
+// authenticating and securing access to the served account: -cert, -key,
+// and -clientca are required, and the server demands a client certificate
+// signed by -clientca before it will talk 9P to it. Pass -insecure to serve
+// over plain, unauthenticated TCP instead; it is never the default.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/rschio/upspinfsys/upspin9p"
+
+	"upspin.io/config"
+	"upspin.io/flags"
+	"upspin.io/log"
+	"upspin.io/upspin"
+
+	_ "upspin.io/pack/ee"
+	_ "upspin.io/pack/eeintegrity"
+	_ "upspin.io/pack/plain"
+
+	"upspin.io/client"
+	"upspin.io/transports"
+)
+
+const cmdName = "upspin9p"
+
+var (
+	users    userList
+	addr     = flag.String("addr", ":5640", "address to serve 9P2000.L on")
+	cert     = flag.String("cert", "", "TLS certificate `file`")
+	keyFile  = flag.String("key", "", "TLS private key `file`")
+	clientCA = flag.String("clientca", "", "PEM `file` of CA certificates trusted to sign client certificates")
+	insecure = flag.Bool("insecure", false, "serve over plain, unauthenticated TCP instead of requiring mutual TLS")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s -user=<user> [-user=<user> ...]\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Var(&users, "user", "Upspin `user` tree to expose as a top-level directory; may be repeated")
+	flag.Usage = usage
+	flags.Parse(flags.Server)
+
+	if len(users) == 0 {
+		log.Fatalf("%s: at least one -user is required", cmdName)
+	}
+	if !*insecure && (*cert == "" || *keyFile == "" || *clientCA == "") {
+		log.Fatalf("%s: -cert, -key, and -clientca are required unless -insecure is set", cmdName)
+	}
+
+	cfg, err := config.FromFile(flags.Config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	transports.Init(cfg)
+	c := client.New(cfg)
+
+	ln, err := listen(*addr, *cert, *keyFile, *clientCA, *insecure)
+	if err != nil {
+		log.Fatalf("%s: listen on %s: %s", cmdName, *addr, err)
+	}
+
+	log.Printf("%s: serving %v on %s", cmdName, []upspin.UserName(users), ln.Addr())
+	if err := upspin9p.Serve(ln, c, users); err != nil {
+		log.Fatalf("%s: serve: %s", cmdName, err)
+	}
+}
+
+// listen returns a TCP listener on addr requiring mutual TLS: the server
+// presents cert/key and will only complete a handshake with a client
+// certificate signed by clientCA. If insecure is true, it instead returns a
+// plain, unauthenticated TCP listener.
+func listen(addr, cert, key, clientCA string, insecure bool) (net.Listener, error) {
+	if insecure {
+		log.Error.Printf("%s: -insecure set: serving without authentication", cmdName)
+		return net.Listen("tcp", addr)
+	}
+
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, err
+	}
+	pem, err := os.ReadFile(clientCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no certificates found in %s", cmdName, clientCA)
+	}
+	return tls.Listen("tcp", addr, &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+}
+
+// userList is a flag.Value that collects repeated -user flags.
+type userList []upspin.UserName
+
+func (u *userList) String() string {
+	return fmt.Sprint(*u)
+}
+
+func (u *userList) Set(s string) error {
+	*u = append(*u, upspin.UserName(s))
+	return nil
+}
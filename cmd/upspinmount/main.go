@@ -0,0 +1,89 @@
+// Upspinmount mounts one or more Upspin user trees as a local FUSE
+// filesystem using the upspinfuse package, so that any tool that reads the
+// local filesystem can ls, cat, or serve Upspin content without Go glue code.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+
+	"github.com/rschio/upspinfsys/upspinfuse"
+
+	"upspin.io/config"
+	"upspin.io/flags"
+	"upspin.io/log"
+	"upspin.io/upspin"
+
+	_ "upspin.io/pack/ee"
+	_ "upspin.io/pack/eeintegrity"
+	_ "upspin.io/pack/plain"
+
+	"upspin.io/client"
+	"upspin.io/transports"
+)
+
+const cmdName = "upspinmount"
+
+var users userList
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s -user=<user> [-user=<user> ...] <mount point>\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Var(&users, "user", "Upspin `user` tree to expose as a top-level directory; may be repeated")
+	flag.Usage = usage
+	flags.Parse(flags.Server)
+
+	if flag.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+	if len(users) == 0 {
+		log.Fatalf("%s: at least one -user is required", cmdName)
+	}
+
+	mountpoint, err := filepath.Abs(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("%s: can't determine absolute path to mount point %s: %s", cmdName, flag.Arg(0), err)
+	}
+
+	cfg, err := config.FromFile(flags.Config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	transports.Init(cfg)
+	c := client.New(cfg)
+
+	server, err := upspinfuse.Mount(mountpoint, c, users, cfg, &fs.Options{})
+	if err != nil {
+		log.Fatalf("%s: mount %s: %s", cmdName, mountpoint, err)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		server.Unmount()
+	}()
+
+	server.Wait()
+}
+
+// userList is a flag.Value that collects repeated -user flags.
+type userList []upspin.UserName
+
+func (u *userList) String() string {
+	return fmt.Sprint(*u)
+}
+
+func (u *userList) Set(s string) error {
+	*u = append(*u, upspin.UserName(s))
+	return nil
+}
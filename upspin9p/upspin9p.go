@@ -0,0 +1,262 @@
+// Package upspin9p serves an Upspin tree over 9P2000.L using
+// github.com/hugelgupf/p9, so that any 9P client (including the Linux kernel's
+// own v9fs) can read Upspin content without Go glue code or distributing
+// Upspin keys to the consumer. Unlike upspinfsys, which exposes the tree
+// through io/fs, this package talks to upspin.Client directly so it can
+// preserve information io/fs has no room for, such as unresolved symlinks.
+//
+// Upspin has no global root: every name starts with a user name. Since it is
+// impractical to enumerate every Upspin user, the set of user trees to show
+// at the top level of the served tree must be given explicitly to Serve.
+//
+// The served tree is read-only: write operations report linux.ENOSYS.
+package upspin9p
+
+import (
+	"hash/fnv"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hugelgupf/p9/fsimpl/templatefs"
+	"github.com/hugelgupf/p9/linux"
+	"github.com/hugelgupf/p9/p9"
+
+	"upspin.io/errors"
+	"upspin.io/path"
+	"upspin.io/upspin"
+)
+
+// Serve serves the Upspin trees of users over 9P2000.L on ln. It blocks
+// until ln is closed or an unrecoverable error occurs.
+func Serve(ln net.Listener, c upspin.Client, users []upspin.UserName) error {
+	root := &node{client: c, roots: users}
+	return p9.NewServer(root).Serve(ln)
+}
+
+// node is a 9P file mapping to a single Upspin DirEntry. The root node
+// (name == "") is synthetic: its children are the user trees passed to
+// Serve, not a real Upspin directory.
+type node struct {
+	templatefs.NoopFile
+	p9.DefaultWalkGetAttr
+
+	client upspin.Client
+	name   upspin.PathName
+	roots  []upspin.UserName
+
+	file upspin.File
+}
+
+var _ p9.File = (*node)(nil)
+
+func (n *node) isRoot() bool { return n.name == "" }
+
+// Attach implements p9.Attacher.
+func (n *node) Attach() (p9.File, error) {
+	return n, nil
+}
+
+func (n *node) Walk(names []string) ([]p9.QID, p9.File, error) {
+	if len(names) == 0 {
+		clone := *n
+		clone.file = nil
+		return nil, &clone, nil
+	}
+
+	qids := make([]p9.QID, 0, len(names))
+	cur := n
+	for _, name := range names {
+		var childName upspin.PathName
+		if cur.isRoot() {
+			found := false
+			for _, u := range cur.roots {
+				if string(u) == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, nil, linux.ENOENT
+			}
+			childName = upspin.PathName(name)
+		} else {
+			childName = path.Join(cur.name, name)
+		}
+
+		de, err := n.client.Lookup(childName, false)
+		if err != nil {
+			return nil, nil, errno(err)
+		}
+		qid, _ := attrFor(de)
+		qids = append(qids, qid)
+		cur = &node{client: n.client, name: de.Name}
+	}
+	return qids, cur, nil
+}
+
+func (n *node) GetAttr(req p9.AttrMask) (p9.QID, p9.AttrMask, p9.Attr, error) {
+	if n.isRoot() {
+		return rootQID, req, rootAttr, nil
+	}
+	de, err := n.client.Lookup(n.name, false)
+	if err != nil {
+		return p9.QID{}, p9.AttrMask{}, p9.Attr{}, errno(err)
+	}
+	qid, attr := attrFor(de)
+	return qid, req, attr, nil
+}
+
+func (n *node) Open(mode p9.OpenFlags) (p9.QID, uint32, error) {
+	if n.isRoot() {
+		return rootQID, 0, nil
+	}
+	de, err := n.client.Lookup(n.name, false)
+	if err != nil {
+		return p9.QID{}, 0, errno(err)
+	}
+	qid, _ := attrFor(de)
+	if de.IsDir() {
+		return qid, 0, nil
+	}
+	f, err := n.client.Open(n.name)
+	if err != nil {
+		return p9.QID{}, 0, errno(err)
+	}
+	n.file = f
+	return qid, 0, nil
+}
+
+func (n *node) ReadAt(p []byte, offset int64) (int, error) {
+	if n.file == nil {
+		return 0, linux.EINVAL
+	}
+	nr, err := n.file.ReadAt(p, offset)
+	if err == io.EOF {
+		return nr, io.EOF
+	}
+	if err != nil {
+		return nr, errno(err)
+	}
+	return nr, nil
+}
+
+func (n *node) Readdir(offset uint64, count uint32) (p9.Dirents, error) {
+	var dirents p9.Dirents
+	if n.isRoot() {
+		for _, u := range n.roots {
+			qid := p9.QID{Type: p9.TypeDir, Path: qidPath(upspin.PathName(u))}
+			dirents = append(dirents, p9.Dirent{QID: qid, Type: qid.Type, Name: string(u)})
+		}
+	} else {
+		pattern := string(path.Join(n.name, "*"))
+		des, err := n.client.Glob(pattern)
+		if err != nil {
+			return nil, errno(err)
+		}
+		sort.Slice(des, func(i, j int) bool { return des[i].Name < des[j].Name })
+		for _, de := range des {
+			qid, _ := attrFor(de)
+			dirents = append(dirents, p9.Dirent{QID: qid, Type: qid.Type, Name: baseName(de.Name)})
+		}
+	}
+
+	for i := range dirents {
+		dirents[i].Offset = uint64(i) + 1
+	}
+	if offset >= uint64(len(dirents)) {
+		return nil, nil
+	}
+	dirents = dirents[offset:]
+	if count > 0 && uint64(len(dirents)) > uint64(count) {
+		dirents = dirents[:count]
+	}
+	return dirents, nil
+}
+
+func (n *node) Readlink() (string, error) {
+	de, err := n.client.Lookup(n.name, false)
+	if err != nil {
+		return "", errno(err)
+	}
+	if !de.IsLink() {
+		return "", linux.EINVAL
+	}
+	return string(de.Link), nil
+}
+
+func (n *node) Close() error {
+	if n.file == nil {
+		return nil
+	}
+	return n.file.Close()
+}
+
+var (
+	rootQID  = p9.QID{Type: p9.TypeDir}
+	rootAttr = p9.Attr{Mode: p9.ModeFromOS(os.ModeDir | 0555)}
+)
+
+// attrFor returns the QID and Attr describing de.
+func attrFor(de *upspin.DirEntry) (p9.QID, p9.Attr) {
+	size, _ := de.Size()
+	mode := modeFor(de)
+	qid := p9.QID{Type: mode.QIDType(), Path: qidPath(de.Name)}
+	attr := p9.Attr{
+		Mode:         mode,
+		Size:         uint64(size),
+		MTimeSeconds: uint64(de.Time.Go().Unix()),
+	}
+	return qid, attr
+}
+
+// modeFor returns the read-only p9.FileMode for de.
+func modeFor(de *upspin.DirEntry) p9.FileMode {
+	switch {
+	case de.IsDir():
+		return p9.ModeFromOS(os.ModeDir | 0555)
+	case de.IsLink():
+		return p9.ModeFromOS(os.ModeSymlink | 0777)
+	default:
+		return p9.ModeFromOS(0444)
+	}
+}
+
+// qidPath derives a QID.Path unique to name within this server.
+func qidPath(name upspin.PathName) uint64 {
+	h := fnv.New64a()
+	io.WriteString(h, string(name))
+	return h.Sum64()
+}
+
+// baseName returns the last path element of name. A bare user name with no
+// path element below it, such as "user@example.com", is returned unchanged.
+func baseName(name upspin.PathName) string {
+	n := strings.TrimSuffix(string(name), "/")
+	if i := strings.LastIndexByte(n, '/'); i >= 0 {
+		return n[i+1:]
+	}
+	return n
+}
+
+// errno maps an Upspin error to the closest 9P/Linux errno.
+func errno(err error) error {
+	switch {
+	case errors.Is(errors.NotExist, err):
+		return linux.ENOENT
+	case errors.Is(errors.Permission, err):
+		return linux.EACCES
+	case errors.Is(errors.Exist, err):
+		return linux.EEXIST
+	case errors.Is(errors.NotDir, err):
+		return linux.ENOTDIR
+	case errors.Is(errors.IsDir, err):
+		return linux.EISDIR
+	case errors.Is(errors.NotEmpty, err):
+		return linux.ENOTEMPTY
+	default:
+		return linux.EIO
+	}
+}
@@ -0,0 +1,128 @@
+package upspin9p
+
+import (
+	"io"
+	"testing"
+
+	"github.com/hugelgupf/p9/linux"
+	"github.com/hugelgupf/p9/p9"
+
+	"github.com/rschio/upspinfsys/upspintest"
+
+	uerrors "upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+func TestErrno(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"not exist", uerrors.E(uerrors.NotExist), linux.ENOENT},
+		{"permission", uerrors.E(uerrors.Permission), linux.EACCES},
+		{"exist", uerrors.E(uerrors.Exist), linux.EEXIST},
+		{"not dir", uerrors.E(uerrors.NotDir), linux.ENOTDIR},
+		{"is dir", uerrors.E(uerrors.IsDir), linux.EISDIR},
+		{"not empty", uerrors.E(uerrors.NotEmpty), linux.ENOTEMPTY},
+		{"other", uerrors.E(uerrors.Str("boom")), linux.EIO},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := errno(c.err); got != c.want {
+				t.Fatalf("errno(%v) = %v, want %v", c.err, got, c.want)
+			}
+		})
+	}
+}
+
+// baseName is only ever called with a DirEntry.Name that has at least one
+// path element below the user root: root nodes are synthetic and handled by
+// isRoot() instead of going through a DirEntry at all.
+func TestBaseName(t *testing.T) {
+	cases := []struct {
+		name upspin.PathName
+		want string
+	}{
+		{"user@example.com/a", "a"},
+		{"user@example.com/a/b", "b"},
+	}
+	for _, c := range cases {
+		if got := baseName(c.name); got != c.want {
+			t.Errorf("baseName(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNodeWalkRead(t *testing.T) {
+	const (
+		owner = "user@example.com"
+		name  = owner + "/documents/doc.txt"
+	)
+	client := upspintest.NewClient(map[string]upspintest.File{
+		name: {Data: []byte("hello world")},
+	})
+	root := &node{client: client, roots: []upspin.UserName{owner}}
+
+	_, userFile, err := root.Walk([]string{owner})
+	if err != nil {
+		t.Fatalf("Walk(%s): %v", owner, err)
+	}
+	userNode := userFile.(*node)
+
+	_, docsFile, err := userNode.Walk([]string{"documents"})
+	if err != nil {
+		t.Fatalf("Walk(documents): %v", err)
+	}
+	docsNode := docsFile.(*node)
+
+	dirents, err := docsNode.Readdir(0, 0)
+	if err != nil {
+		t.Fatalf("Readdir: %v", err)
+	}
+	if len(dirents) != 1 || dirents[0].Name != "doc.txt" {
+		t.Fatalf("Readdir(documents) = %v, want [doc.txt]", dirents)
+	}
+
+	_, fileFile, err := docsNode.Walk([]string{"doc.txt"})
+	if err != nil {
+		t.Fatalf("Walk(doc.txt): %v", err)
+	}
+	fileNode := fileFile.(*node)
+
+	_, _, attr, err := fileNode.GetAttr(p9.AttrMaskAll)
+	if err != nil {
+		t.Fatalf("GetAttr: %v", err)
+	}
+	if attr.Size != uint64(len("hello world")) {
+		t.Fatalf("GetAttr size = %d, want %d", attr.Size, len("hello world"))
+	}
+
+	if _, _, err := fileNode.Open(p9.ReadOnly); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	buf := make([]byte, 5)
+	n, err := fileNode.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Fatalf("ReadAt = %q, want %q", buf[:n], "hello")
+	}
+
+	if err := fileNode.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestNodeWalkNotFound(t *testing.T) {
+	const owner = "user@example.com"
+	client := upspintest.NewClient(map[string]upspintest.File{
+		owner + "/documents/doc.txt": {Data: []byte("hello")},
+	})
+	root := &node{client: client, roots: []upspin.UserName{owner}}
+
+	if _, _, err := root.Walk([]string{"nobody@example.com"}); err != linux.ENOENT {
+		t.Fatalf("Walk(unknown root) = %v, want ENOENT", err)
+	}
+}
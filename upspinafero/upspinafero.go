@@ -0,0 +1,170 @@
+// Package upspinafero adapts upspinfsys.WriteFS to the afero.Fs interface
+// (github.com/spf13/afero), so an Upspin tree can be used with the ecosystem
+// of tools built against afero instead of the narrower io/fs surface.
+package upspinafero
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/rschio/upspinfsys"
+	"github.com/spf13/afero"
+	"upspin.io/upspin"
+)
+
+var errNotSupported = errors.New("upspinafero: not supported: permissions are governed by the nearest Access file, not file mode bits")
+
+// New returns an afero.Fs backed by the Upspin tree reachable by c.
+func New(c upspin.Client) afero.Fs {
+	return aferoFS{wfs: upspinfsys.UpspinWriteFS(c)}
+}
+
+type aferoFS struct {
+	wfs upspinfsys.WriteFS
+}
+
+func (a aferoFS) Create(name string) (afero.File, error) {
+	f, err := a.wfs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return file{File: f, name: name}, nil
+}
+
+func (a aferoFS) Mkdir(name string, perm os.FileMode) error {
+	return a.wfs.Mkdir(name, fs.FileMode(perm))
+}
+
+func (a aferoFS) MkdirAll(path string, perm os.FileMode) error {
+	return a.wfs.MkdirAll(path, fs.FileMode(perm))
+}
+
+func (a aferoFS) Open(name string) (afero.File, error) {
+	f, err := a.wfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return file{File: f, name: name}, nil
+}
+
+func (a aferoFS) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	f, err := a.wfs.OpenFile(name, flag, fs.FileMode(perm))
+	if err != nil {
+		return nil, err
+	}
+	return file{File: f, name: name}, nil
+}
+
+func (a aferoFS) Remove(name string) error {
+	return a.wfs.Remove(name)
+}
+
+func (a aferoFS) RemoveAll(path string) error {
+	return a.wfs.RemoveAll(path)
+}
+
+func (a aferoFS) Rename(oldname, newname string) error {
+	return a.wfs.Rename(oldname, newname)
+}
+
+func (a aferoFS) Stat(name string) (os.FileInfo, error) {
+	return fs.Stat(a.wfs, name)
+}
+
+func (a aferoFS) Name() string {
+	return "upspinafero"
+}
+
+func (a aferoFS) Chmod(name string, mode os.FileMode) error         { return errNotSupported }
+func (a aferoFS) Chown(name string, uid, gid int) error             { return errNotSupported }
+func (a aferoFS) Chtimes(name string, atime, mtime time.Time) error { return errNotSupported }
+
+// file adapts an fs.File, which may additionally implement io.Writer,
+// io.WriterAt, io.ReaderAt, io.Seeker, and fs.ReadDirFile, to afero.File.
+type file struct {
+	fs.File
+	name string
+}
+
+func (f file) Name() string { return f.name }
+
+func (f file) Write(b []byte) (int, error) {
+	w, ok := f.File.(interface{ Write([]byte) (int, error) })
+	if !ok {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return w.Write(b)
+}
+
+func (f file) WriteAt(b []byte, off int64) (int, error) {
+	w, ok := f.File.(interface {
+		WriteAt([]byte, int64) (int, error)
+	})
+	if !ok {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return w.WriteAt(b, off)
+}
+
+func (f file) ReadAt(b []byte, off int64) (int, error) {
+	r, ok := f.File.(interface {
+		ReadAt([]byte, int64) (int, error)
+	})
+	if !ok {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return r.ReadAt(b, off)
+}
+
+func (f file) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(interface {
+		Seek(int64, int) (int64, error)
+	})
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return s.Seek(offset, whence)
+}
+
+func (f file) Readdir(count int) ([]os.FileInfo, error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fs.ErrInvalid}
+	}
+	des, err := d.ReadDir(count)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, len(des))
+	for i, de := range des {
+		infos[i], err = de.Info()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+func (f file) Readdirnames(n int) ([]string, error) {
+	infos, err := f.Readdir(n)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(infos))
+	for i, fi := range infos {
+		names[i] = fi.Name()
+	}
+	return names, nil
+}
+
+func (f file) Sync() error { return nil }
+
+func (f file) Truncate(size int64) error {
+	return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+}
+
+func (f file) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
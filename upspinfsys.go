@@ -1,9 +1,6 @@
 // Package upspinfsys provides an implementation of fs.FS interface for Upspin.
 // It implements the fs.FS interface and the necessary methods to serve it using
 // the http.FileServer too.
-//
-// Limitations:
-//   - The FileMode does not represent the Access file correctly.
 package upspinfsys
 
 import (
@@ -14,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"upspin.io/access"
 	"upspin.io/errors"
 	"upspin.io/path"
 	"upspin.io/upspin"
@@ -21,13 +19,75 @@ import (
 
 type uFS struct {
 	client upspin.Client
+	cache  *blockCache
+	cfg    upspin.Config
+}
+
+// Option configures the fs.FS returned by UpspinFS.
+type Option func(*uFS)
+
+// WithBlockCache enables a read-through cache of fixed-size blocks in front
+// of the underlying upspin.File, so that repeated or overlapping reads of
+// the same file, such as the range requests http.FileServer issues while
+// serving media, don't refetch the same bytes from the StoreServer. size is
+// the maximum number of blocks the cache retains, across all open files;
+// blockSize is the size of each block in bytes. Use CacheStats to read the
+// resulting cache's hit and miss counters.
+func WithBlockCache(size int, blockSize int64) Option {
+	return func(u *uFS) {
+		u.cache = newBlockCache(size, blockSize)
+	}
+}
+
+// WithAccess makes Mode(), as reported by Stat and ReadDir, reflect the
+// rights cfg.UserName() actually has according to the nearest Access file,
+// instead of the permissive owner-only default used without this option.
+func WithAccess(cfg upspin.Config) Option {
+	return func(u *uFS) {
+		u.cfg = cfg
+	}
 }
 
 // UpspinFS returns a fs.FS implementation.
 // To use the Open function is necessary to pass the full path of the file
 // (the file system is not rooted at client's home).
-func UpspinFS(c upspin.Client) fs.FS {
-	return uFS{client: c}
+func UpspinFS(c upspin.Client, opts ...Option) fs.FS {
+	u := uFS{client: c}
+	for _, opt := range opts {
+		opt(&u)
+	}
+	return u
+}
+
+// SubForUser returns the subtree of fsys rooted at userName's home
+// directory. Upspin has no global root fs.Sub can rely on directly: fsys
+// itself only answers ReadDir(".") for a literal Upspin path, and listing
+// every Upspin user is neither possible nor desirable. Rooting the Sub at a
+// single user's name, as TestStd does, sidesteps that: everything below the
+// user name is an ordinary Upspin path fsys already knows how to serve.
+func SubForUser(fsys fs.FS, userName upspin.UserName) (fs.FS, error) {
+	return fs.Sub(fsys, string(userName))
+}
+
+// CacheStats returns the hit and miss counters of the block cache fsys was
+// created with using WithBlockCache. It reports false if fsys has no block
+// cache.
+func CacheStats(fsys fs.FS) (Stats, bool) {
+	u, ok := fsys.(uFS)
+	if !ok || u.cache == nil {
+		return Stats{}, false
+	}
+	return u.cache.Stats(), true
+}
+
+// FileInfo reports de's fs.FileInfo the way UpspinFS's own Stat/ReadDir do:
+// Mode() reflects the rights cfg.UserName() has according to the nearest
+// Access file, or the permissive 0700 default if cfg is nil. It lets other
+// packages that talk to upspin.Client directly, such as upspinfuse, derive
+// attributes from a DirEntry without reimplementing modeFor.
+func FileInfo(c upspin.Client, cfg upspin.Config, de *upspin.DirEntry) fs.FileInfo {
+	u := uFS{client: c, cfg: cfg}
+	return u.fileInfo(de)
 }
 
 func (u uFS) Open(name string) (fs.File, error) {
@@ -39,23 +99,15 @@ func (u uFS) Open(name string) (fs.File, error) {
 
 	de, err := u.client.Lookup(upspin.PathName(name), true)
 	if err != nil {
-		switch {
-		case errors.Is(errors.NotExist, err):
-			err = fs.ErrNotExist
-		case errors.Is(errors.Permission, err):
-			err = fs.ErrPermission
-		default:
-			err = fmt.Errorf("failed to lookup file %s: %w", name, err)
-		}
 		return nil, &fs.PathError{
 			Op:   op,
 			Path: name,
-			Err:  err,
+			Err:  translateErr(err, fmt.Sprintf("failed to lookup file %s", name)),
 		}
 	}
 
 	if de.IsDir() {
-		return &dir{de: de, client: u.client}, nil
+		return &dir{de: de, u: u}, nil
 	}
 
 	if !de.IsRegular() {
@@ -71,17 +123,21 @@ func (u uFS) Open(name string) (fs.File, error) {
 		return nil, &fs.PathError{
 			Op:   op,
 			Path: name,
-			Err:  fmt.Errorf("failed to open file %s: %w", name, err),
+			Err:  translateErr(err, fmt.Sprintf("failed to open file %s", name)),
 		}
 	}
-	return file{file: f, de: de}, nil
+	if u.cache != nil {
+		return &cachedFile{file: f, de: de, cache: u.cache, u: u}, nil
+	}
+	return file{file: f, de: de, u: u}, nil
 }
 
 func (u uFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	const op = "readdir"
 	pattern := string(path.Join(upspin.PathName(name), "*"))
-	des, err := glob(u.client, pattern)
+	des, err := glob(u, pattern)
 	if err != nil {
-		return nil, fmt.Errorf("readdir: %s: %w", name, err)
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
 	}
 	sort.Slice(des, func(i, j int) bool { return des[i].Name() < des[j].Name() })
 	return des, nil
@@ -107,6 +163,7 @@ func (u uFS) Glob(pattern string) ([]string, error) {
 type file struct {
 	file upspin.File
 	de   *upspin.DirEntry
+	u    uFS
 }
 
 func (f file) Close() error {
@@ -126,11 +183,11 @@ func (f file) Seek(offset int64, whence int) (ret int64, err error) {
 }
 
 func (f file) Stat() (fs.FileInfo, error) {
-	return fileInfo(f.de), nil
+	return f.u.fileInfo(f.de), nil
 }
 
 type dir struct {
-	client        upspin.Client
+	u             uFS
 	de            *upspin.DirEntry
 	entries       []fs.DirEntry
 	entriesOffset int
@@ -145,7 +202,7 @@ func (d *dir) Read(b []byte) (n int, err error) {
 }
 
 func (d *dir) Stat() (fs.FileInfo, error) {
-	return fileInfo(d.de), nil
+	return d.u.fileInfo(d.de), nil
 }
 
 func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
@@ -170,9 +227,9 @@ func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
 	}
 
 	pattern := string(path.Join(d.de.Name, "*"))
-	des, err := glob(d.client, pattern)
+	des, err := glob(d.u, pattern)
 	if err != nil {
-		return nil, fmt.Errorf("reddir %s: %w", d.de.Name, err)
+		return nil, &fs.PathError{Op: "readdir", Path: string(d.de.Name), Err: err}
 	}
 	d.entries = des
 
@@ -184,38 +241,58 @@ func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
 	return d.entries[:n], nil
 }
 
-func glob(c upspin.Client, pattern string) ([]fs.DirEntry, error) {
-	entries, err := c.Glob(pattern)
+func glob(u uFS, pattern string) ([]fs.DirEntry, error) {
+	entries, err := u.client.Glob(pattern)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get dir entries: %w", err)
+		return nil, translateErr(err, fmt.Sprintf("failed to get dir entries: %s", pattern))
 	}
 	des := make([]fs.DirEntry, len(entries))
 	for i, e := range entries {
-		des[i] = dirEntry(e)
+		des[i] = u.dirEntry(e)
 	}
 	return des, nil
 }
 
-func dirEntry(de *upspin.DirEntry) fs.DirEntry {
-	info := fileInfo(de)
+func (u uFS) dirEntry(de *upspin.DirEntry) fs.DirEntry {
+	info := u.fileInfo(de)
 	return fs.FileInfoToDirEntry(info)
 }
 
-func fileInfo(de *upspin.DirEntry) info {
-	size, _ := de.Size()
+// translateErr maps an Upspin error to the closest fs sentinel error, falling
+// back to wrapping it with msg when there is no good match.
+func translateErr(err error, msg string) error {
+	switch {
+	case errors.Is(errors.NotExist, err):
+		return fs.ErrNotExist
+	case errors.Is(errors.Permission, err):
+		return fs.ErrPermission
+	case errors.Is(errors.Exist, err):
+		return fs.ErrExist
+	default:
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+}
 
-	fpath := path.DropPath(de.Name, 1)
-	name := string(de.Name[len(fpath):])
-	if fpath == de.Name {
-		name = string(fpath)
-		name, _ = strings.CutSuffix(name, "/")
+// baseName returns the last path element of de.Name, the same value
+// fs.FileInfo.Name is expected to report. A bare user name with no path
+// element below it, such as "user@example.com", is returned unchanged:
+// path.DropPath(name, 1) pads it with a trailing slash rather than
+// shortening it, which makes slicing by its length unsafe.
+func baseName(name upspin.PathName) string {
+	n := string(name)
+	n, _ = strings.CutSuffix(n, "/")
+	if i := strings.LastIndexByte(n, '/'); i >= 0 {
+		return n[i+1:]
 	}
-	name, _ = strings.CutPrefix(name, "/")
+	return n
+}
+
+func (u uFS) fileInfo(de *upspin.DirEntry) info {
+	size, _ := de.Size()
+
+	name := baseName(de.Name)
 
-	// TODO: Think in a way to reflect the actual Access file permissions.
-	// Using 0700 gives the owner read and execute permissions, write is not
-	// possible because the fs.FS interface is read only.
-	var mode fs.FileMode = 0700
+	mode := u.modeFor(de)
 	switch {
 	case de.IsDir():
 		mode |= fs.ModeDir
@@ -232,6 +309,88 @@ func fileInfo(de *upspin.DirEntry) info {
 	}
 }
 
+// modeFor computes the permission bits of de from the rights the nearest
+// Access file grants u.cfg.UserName(). The result only ever sets the
+// owner-read/write/execute trio (0400/0200/0100): fs.FileMode has no good
+// way to express Upspin's richer group semantics, and a Mode() is only ever
+// observed from the single perspective of u.cfg.UserName(), so there is no
+// "other user" to hold group or world bits for.
+//
+// Without WithAccess, u.cfg is nil and modeFor falls back to the permissive
+// 0700 used before Access files were consulted at all.
+func (u uFS) modeFor(de *upspin.DirEntry) fs.FileMode {
+	if u.cfg == nil {
+		return 0700
+	}
+
+	user := u.cfg.UserName()
+	p, err := path.Parse(de.Name)
+	if err != nil {
+		return 0
+	}
+	if user == p.User() {
+		// Access.Can already grants the owner Read and List regardless
+		// of what the Access file says, but an owner with no Access
+		// file at all should still be able to create and write, so
+		// that case is handled here instead of by a nil *access.Access
+		// falling through to "no rights" below.
+		return 0700
+	}
+
+	a, err := u.nearestAccess(de)
+	if err != nil || a == nil {
+		return 0
+	}
+
+	load := func(name upspin.PathName) ([]byte, error) {
+		return u.client.Get(name)
+	}
+
+	var mode fs.FileMode
+	if ok, _ := a.Can(user, access.Read, de.Name, load); ok {
+		mode |= 0400
+	}
+	if ok, _ := a.Can(user, access.List, de.Name, load); ok {
+		mode |= 0100
+	}
+	if ok, _ := a.Can(user, access.Write, de.Name, load); ok {
+		mode |= 0200
+	} else if ok, _ := a.Can(user, access.Create, de.Name, load); ok {
+		mode |= 0200
+	}
+	return mode
+}
+
+// nearestAccess returns the parsed Access file that governs de, walking up
+// from de itself (if de is a directory) or de's containing directory, up to
+// the user's root, and returning the first Access file found. It returns a
+// nil *access.Access, with no error, if the tree holds no Access file at all.
+func (u uFS) nearestAccess(de *upspin.DirEntry) (*access.Access, error) {
+	dirName := de.Name
+	if !de.IsDir() {
+		dirName = path.DropPath(de.Name, 1)
+	}
+
+	p, err := path.Parse(dirName)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := p.NElem(); i >= 0; i-- {
+		accessName := path.Join(p.First(i).Path(), "Access")
+		data, err := u.client.Get(accessName)
+		switch {
+		case err == nil:
+			return access.Parse(accessName, data)
+		case errors.Is(errors.NotExist, err):
+			continue
+		default:
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
 type info struct {
 	name    string
 	size    int64
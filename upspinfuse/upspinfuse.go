@@ -0,0 +1,306 @@
+// Package upspinfuse mounts an Upspin tree as a local FUSE filesystem using
+// github.com/hanwen/go-fuse/v2/fs. Unlike upspinfsys, which exposes the tree
+// through io/fs, this package talks to upspin.Client directly so it can
+// preserve information io/fs has no room for, such as unresolved symlinks.
+//
+// Upspin has no global root: every name starts with a user name. Since it is
+// impractical to enumerate every Upspin user, the set of user trees to show
+// at the top level of the mount must be given explicitly to Mount.
+package upspinfuse
+
+import (
+	"context"
+	"io"
+	iofs "io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/rschio/upspinfsys"
+
+	"upspin.io/errors"
+	"upspin.io/path"
+	"upspin.io/upspin"
+)
+
+// Mount mounts the Upspin trees of users at mountpoint and starts serving
+// requests. It returns once the mount is ready without waiting for it to be
+// unmounted; call server.Wait to block until then, or server.Unmount to stop
+// serving.
+// cfg is used to derive file modes from Access files the way upspinfsys
+// does; pass nil to fall back to the permissive owner-only default. If opts
+// is nil, go-fuse's defaults are used.
+func Mount(mountpoint string, c upspin.Client, users []upspin.UserName, cfg upspin.Config, opts *fs.Options) (*fuse.Server, error) {
+	root := &node{client: c, cfg: cfg, roots: users}
+	return fs.Mount(mountpoint, root, opts)
+}
+
+// node is a FUSE inode mapping to a single Upspin DirEntry. The root node
+// (name == "") is synthetic: its children are the user trees passed to
+// Mount, not a real Upspin directory.
+type node struct {
+	fs.Inode
+
+	client upspin.Client
+	cfg    upspin.Config
+	name   upspin.PathName
+	roots  []upspin.UserName
+}
+
+var (
+	_ fs.NodeGetattrer  = (*node)(nil)
+	_ fs.NodeLookuper   = (*node)(nil)
+	_ fs.NodeOpener     = (*node)(nil)
+	_ fs.NodeReader     = (*node)(nil)
+	_ fs.NodeReaddirer  = (*node)(nil)
+	_ fs.NodeReadlinker = (*node)(nil)
+	_ fs.FileReleaser   = (*fileHandle)(nil)
+)
+
+func (n *node) isRoot() bool { return n.name == "" }
+
+func (n *node) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if n.isRoot() {
+		out.Mode = syscall.S_IFDIR | 0555
+		return 0
+	}
+	de, err := n.client.Lookup(n.name, false)
+	if err != nil {
+		return errno(err)
+	}
+	setAttr(upspinfsys.FileInfo(n.client, n.cfg, de), &out.Attr)
+	return 0
+}
+
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	var childName upspin.PathName
+	if n.isRoot() {
+		found := false
+		for _, u := range n.roots {
+			if string(u) == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, syscall.ENOENT
+		}
+		childName = upspin.PathName(name)
+	} else {
+		childName = path.Join(n.name, name)
+	}
+
+	de, err := n.client.Lookup(childName, false)
+	if err != nil {
+		return nil, errno(err)
+	}
+	setAttr(upspinfsys.FileInfo(n.client, n.cfg, de), &out.Attr)
+
+	mode := uint32(syscall.S_IFREG)
+	switch {
+	case de.IsDir():
+		mode = syscall.S_IFDIR
+	case de.IsLink():
+		mode = syscall.S_IFLNK
+	}
+	child := &node{client: n.client, cfg: n.cfg, name: de.Name}
+	return n.NewInode(ctx, child, fs.StableAttr{Mode: mode}), 0
+}
+
+func (n *node) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	de, err := n.client.Lookup(n.name, true)
+	if err != nil {
+		return nil, 0, errno(err)
+	}
+	f, err := n.client.Open(n.name)
+	if err != nil {
+		return nil, 0, errno(err)
+	}
+	return newFileHandle(f, de), fuse.FOPEN_KEEP_CACHE, 0
+}
+
+func (n *node) Read(ctx context.Context, f fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	fh, ok := f.(*fileHandle)
+	if !ok {
+		return nil, syscall.EBADF
+	}
+	nr, err := fh.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, errno(err)
+	}
+	return fuse.ReadResultData(dest[:nr]), 0
+}
+
+func (n *node) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	if n.isRoot() {
+		entries := make([]fuse.DirEntry, len(n.roots))
+		for i, u := range n.roots {
+			entries[i] = fuse.DirEntry{Name: string(u), Mode: syscall.S_IFDIR}
+		}
+		return fs.NewListDirStream(entries), 0
+	}
+
+	pattern := string(path.Join(n.name, "*"))
+	des, err := n.client.Glob(pattern)
+	if err != nil {
+		return nil, errno(err)
+	}
+	sort.Slice(des, func(i, j int) bool { return des[i].Name < des[j].Name })
+
+	entries := make([]fuse.DirEntry, len(des))
+	for i, de := range des {
+		mode := uint32(syscall.S_IFREG)
+		switch {
+		case de.IsDir():
+			mode = syscall.S_IFDIR
+		case de.IsLink():
+			mode = syscall.S_IFLNK
+		}
+		entries[i] = fuse.DirEntry{Name: baseName(de.Name), Mode: mode}
+	}
+	return fs.NewListDirStream(entries), 0
+}
+
+func (n *node) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	de, err := n.client.Lookup(n.name, false)
+	if err != nil {
+		return nil, errno(err)
+	}
+	if !de.IsLink() {
+		return nil, syscall.EINVAL
+	}
+	return []byte(de.Link), 0
+}
+
+// fileHandleBlockSize is the block size fileHandle's read cache keys and
+// fetches by.
+const fileHandleBlockSize = 64 << 10
+
+// fileHandle wraps the upspin.File backing an open regular file with a
+// block-level read cache, so that re-reading the same offset, common with
+// mmap'd or randomly-accessed files, doesn't refetch from the StoreServer.
+// Caching by block index alone is safe for the handle's whole life: de is
+// the snapshot Open looked up and is never refreshed, so de.Sequence, and
+// therefore the bytes behind every block, can't change out from under a
+// single fileHandle.
+type fileHandle struct {
+	file upspin.File
+	de   *upspin.DirEntry
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+}
+
+func newFileHandle(file upspin.File, de *upspin.DirEntry) *fileHandle {
+	return &fileHandle{file: file, de: de, blocks: make(map[int64][]byte)}
+}
+
+// ReadAt reads through fh's block cache, fetching and caching whole blocks
+// from fh.file on a miss.
+func (fh *fileHandle) ReadAt(b []byte, off int64) (int, error) {
+	var total int
+	for total < len(b) {
+		pos := off + int64(total)
+		block := pos / fileHandleBlockSize
+		blockStart := block * fileHandleBlockSize
+
+		data, err := fh.block(block)
+		if err != nil {
+			if total > 0 {
+				return total, nil
+			}
+			return 0, err
+		}
+
+		skip := pos - blockStart
+		if skip >= int64(len(data)) {
+			break // Requested offset is at or past EOF.
+		}
+		n := copy(b[total:], data[skip:])
+		total += n
+		if int64(len(data)) < fileHandleBlockSize {
+			break // Short block: reached EOF.
+		}
+	}
+
+	if total < len(b) {
+		return total, io.EOF
+	}
+	return total, nil
+}
+
+func (fh *fileHandle) block(block int64) ([]byte, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	if data, ok := fh.blocks[block]; ok {
+		return data, nil
+	}
+
+	buf := make([]byte, fileHandleBlockSize)
+	n, err := fh.file.ReadAt(buf, block*fileHandleBlockSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	data := buf[:n]
+	fh.blocks[block] = data
+	return data, nil
+}
+
+// Release implements fs.FileReleaser. Without it, every file a client opens
+// through the mount leaks its underlying upspin.File, and whatever
+// StoreServer connection or buffer it holds, for the life of the process.
+func (fh *fileHandle) Release(ctx context.Context) syscall.Errno {
+	return errno(fh.file.Close())
+}
+
+// setAttr fills out with the attributes of fi.
+func setAttr(fi iofs.FileInfo, out *fuse.Attr) {
+	out.Size = uint64(fi.Size())
+	out.Mtime = uint64(fi.ModTime().Unix())
+	mode := fi.Mode()
+	switch {
+	case mode&iofs.ModeDir != 0:
+		out.Mode = syscall.S_IFDIR | uint32(mode.Perm())
+	case mode&iofs.ModeSymlink != 0:
+		out.Mode = syscall.S_IFLNK | uint32(mode.Perm())
+	default:
+		out.Mode = syscall.S_IFREG | uint32(mode.Perm())
+	}
+}
+
+// baseName returns the last path element of name. A bare user name with no
+// path element below it, such as "user@example.com", is returned unchanged.
+func baseName(name upspin.PathName) string {
+	n := strings.TrimSuffix(string(name), "/")
+	if i := strings.LastIndexByte(n, '/'); i >= 0 {
+		return n[i+1:]
+	}
+	return n
+}
+
+// errno maps an Upspin error to the closest syscall errno, or 0 if err is nil.
+func errno(err error) syscall.Errno {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(errors.NotExist, err):
+		return syscall.ENOENT
+	case errors.Is(errors.Permission, err):
+		return syscall.EACCES
+	case errors.Is(errors.Exist, err):
+		return syscall.EEXIST
+	case errors.Is(errors.NotDir, err):
+		return syscall.ENOTDIR
+	case errors.Is(errors.IsDir, err):
+		return syscall.EISDIR
+	case errors.Is(errors.NotEmpty, err):
+		return syscall.ENOTEMPTY
+	default:
+		return syscall.EIO
+	}
+}
@@ -0,0 +1,215 @@
+package upspinfuse
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/rschio/upspinfsys/upspintest"
+
+	uerrors "upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+func TestErrno(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want syscall.Errno
+	}{
+		{"nil", nil, 0},
+		{"not exist", uerrors.E(uerrors.NotExist), syscall.ENOENT},
+		{"permission", uerrors.E(uerrors.Permission), syscall.EACCES},
+		{"exist", uerrors.E(uerrors.Exist), syscall.EEXIST},
+		{"not dir", uerrors.E(uerrors.NotDir), syscall.ENOTDIR},
+		{"is dir", uerrors.E(uerrors.IsDir), syscall.EISDIR},
+		{"not empty", uerrors.E(uerrors.NotEmpty), syscall.ENOTEMPTY},
+		{"other", uerrors.E(uerrors.Str("boom")), syscall.EIO},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := errno(c.err); got != c.want {
+				t.Fatalf("errno(%v) = %v, want %v", c.err, got, c.want)
+			}
+		})
+	}
+}
+
+// baseName is only ever called with a DirEntry.Name that has at least one
+// path element below the user root: root nodes are synthetic and handled by
+// isRoot() instead of going through a DirEntry at all.
+func TestBaseName(t *testing.T) {
+	cases := []struct {
+		name upspin.PathName
+		want string
+	}{
+		{"user@example.com/a", "a"},
+		{"user@example.com/a/b", "b"},
+	}
+	for _, c := range cases {
+		if got := baseName(c.name); got != c.want {
+			t.Errorf("baseName(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+// countingFile wraps an upspin.File and counts ReadAt calls, so tests can
+// tell whether fileHandle's block cache actually avoided a re-fetch.
+type countingFile struct {
+	upspin.File
+	reads atomic.Int64
+}
+
+func (f *countingFile) ReadAt(b []byte, off int64) (int, error) {
+	f.reads.Add(1)
+	return f.File.ReadAt(b, off)
+}
+
+func TestFileHandleReadCache(t *testing.T) {
+	const name = "user@example.com/big.txt"
+	data := make([]byte, 3*fileHandleBlockSize+10)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	client := upspintest.NewClient(map[string]upspintest.File{name: {Data: data}})
+
+	de, err := client.Lookup(name, true)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	f, err := client.Open(name)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	cf := &countingFile{File: f}
+	fh := newFileHandle(cf, de)
+
+	buf := make([]byte, len(data))
+	n, err := fh.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if n != len(data) || string(buf[:n]) != string(data) {
+		t.Fatalf("ReadAt returned %d bytes, want %d matching bytes", n, len(data))
+	}
+	after := cf.reads.Load()
+	if after == 0 {
+		t.Fatal("expected at least one underlying ReadAt on first read")
+	}
+
+	// Re-reading the same range must come entirely from the cache.
+	buf2 := make([]byte, len(data))
+	if _, err := fh.ReadAt(buf2, 0); err != nil && err != io.EOF {
+		t.Fatalf("second ReadAt: %v", err)
+	}
+	if string(buf2) != string(data) {
+		t.Fatal("second ReadAt returned different data")
+	}
+	if got := cf.reads.Load(); got != after {
+		t.Fatalf("second ReadAt issued %d more underlying ReadAt calls, want 0", got-after)
+	}
+}
+
+// newTestRoot builds a root node with its bridge initialized via
+// fs.NewNodeFS, the same setup fs.Mount does internally, so n.NewInode
+// works from Lookup without requiring an actual FUSE mount.
+func newTestRoot(client upspin.Client, cfg upspin.Config, roots []upspin.UserName) *node {
+	root := &node{client: client, cfg: cfg, roots: roots}
+	fs.NewNodeFS(root, &fs.Options{})
+	return root
+}
+
+func TestNodeWalkRead(t *testing.T) {
+	const (
+		owner = "user@example.com"
+		name  = owner + "/documents/doc.txt"
+	)
+	client := upspintest.NewClient(map[string]upspintest.File{
+		name: {Data: []byte("hello world")},
+	})
+	ctx := context.Background()
+	root := newTestRoot(client, nil, []upspin.UserName{owner})
+
+	var entryOut fuse.EntryOut
+	userInode, errno := root.Lookup(ctx, owner, &entryOut)
+	if errno != 0 {
+		t.Fatalf("Lookup(%s): errno %v", owner, errno)
+	}
+	userNode := userInode.Operations().(*node)
+
+	docsInode, errno := userNode.Lookup(ctx, "documents", &entryOut)
+	if errno != 0 {
+		t.Fatalf("Lookup(documents): errno %v", errno)
+	}
+	docsNode := docsInode.Operations().(*node)
+
+	var dirEntries []string
+	stream, errno := docsNode.Readdir(ctx)
+	if errno != 0 {
+		t.Fatalf("Readdir: errno %v", errno)
+	}
+	for stream.HasNext() {
+		e, errno := stream.Next()
+		if errno != 0 {
+			t.Fatalf("stream.Next: errno %v", errno)
+		}
+		dirEntries = append(dirEntries, e.Name)
+	}
+	if len(dirEntries) != 1 || dirEntries[0] != "doc.txt" {
+		t.Fatalf("Readdir(documents) = %v, want [doc.txt]", dirEntries)
+	}
+
+	fileInode, errno := docsNode.Lookup(ctx, "doc.txt", &entryOut)
+	if errno != 0 {
+		t.Fatalf("Lookup(doc.txt): errno %v", errno)
+	}
+	fileNode := fileInode.Operations().(*node)
+
+	var attrOut fuse.AttrOut
+	if errno := fileNode.Getattr(ctx, nil, &attrOut); errno != 0 {
+		t.Fatalf("Getattr: errno %v", errno)
+	}
+	if attrOut.Size != uint64(len("hello world")) {
+		t.Fatalf("Getattr size = %d, want %d", attrOut.Size, len("hello world"))
+	}
+
+	fh, _, errno := fileNode.Open(ctx, 0)
+	if errno != 0 {
+		t.Fatalf("Open: errno %v", errno)
+	}
+	buf := make([]byte, 5)
+	res, errno := fileNode.Read(ctx, fh, buf, 0)
+	if errno != 0 {
+		t.Fatalf("Read: errno %v", errno)
+	}
+	got, status := res.Bytes(buf)
+	if status != fuse.OK {
+		t.Fatalf("ReadResult.Bytes: status %v", status)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("Read = %q, want %q", got, "hello")
+	}
+
+	releaser := fh.(fs.FileReleaser)
+	if errno := releaser.Release(ctx); errno != 0 {
+		t.Fatalf("Release: errno %v", errno)
+	}
+}
+
+func TestNodeLookupNotFound(t *testing.T) {
+	const owner = "user@example.com"
+	client := upspintest.NewClient(map[string]upspintest.File{
+		owner + "/documents/doc.txt": {Data: []byte("hello")},
+	})
+	ctx := context.Background()
+	root := newTestRoot(client, nil, []upspin.UserName{owner})
+
+	if _, errno := root.Lookup(ctx, "nobody@example.com", &fuse.EntryOut{}); errno != syscall.ENOENT {
+		t.Fatalf("Lookup(unknown root) = %v, want ENOENT", errno)
+	}
+}
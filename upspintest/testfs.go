@@ -0,0 +1,53 @@
+package upspintest
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rschio/upspinfsys"
+
+	"upspin.io/upspin"
+)
+
+// TestFS runs testing/fstest.TestFS against the fs.FS wrapping client,
+// verifying that every name in expected is present and that the filesystem
+// obeys the io/fs contract. expected entries are full Upspin path names,
+// e.g. "user@example.com/documents/doc1.txt".
+//
+// Upspin has no global root, so upspinfsys.UpspinFS cannot be tested
+// directly with fstest.TestFS: a ReadDir(".") would have to list every
+// Upspin user (see the discussion in TestStd). TestFS works around this the
+// same way, by rooting the test at the user name shared by every entry in
+// expected with fs.Sub.
+func TestFS(t *testing.T, client upspin.Client, expected ...string) {
+	t.Helper()
+
+	if len(expected) == 0 {
+		t.Fatal("upspintest.TestFS: expected must not be empty")
+	}
+
+	root := strings.SplitN(expected[0], "/", 2)[0]
+	rel := make([]string, len(expected))
+	for i, name := range expected {
+		if name == root {
+			rel[i] = "."
+			continue
+		}
+		r, ok := strings.CutPrefix(name, root+"/")
+		if !ok {
+			t.Fatalf("upspintest.TestFS: %q is not rooted at %q", name, root)
+		}
+		rel[i] = r
+	}
+
+	fsys, err := fs.Sub(upspinfsys.UpspinFS(client), root)
+	if err != nil {
+		t.Fatalf("fs.Sub: %v", err)
+	}
+
+	if err := fstest.TestFS(fsys, rel...); err != nil {
+		t.Fatalf("fstest: %v", err)
+	}
+}
@@ -0,0 +1,559 @@
+// Package upspintest provides an in-memory upspin.Client for testing code
+// built on upspinfsys, so tests don't need to start real key, store, and dir
+// servers with upspin.io/upbox. It mirrors how afero ships both a real and a
+// memory-backed filesystem.
+//
+// NewClient builds a Client from a static map of files, the same way
+// testing/fstest.MapFS builds a filesystem: directories are created
+// implicitly for every named file's ancestors.
+package upspintest
+
+import (
+	"io"
+	stdpath "path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"upspin.io/errors"
+	"upspin.io/path"
+	"upspin.io/upspin"
+)
+
+// File describes a single entry used to seed a Client via NewClient.
+type File struct {
+	// Data is the file's content. It is ignored when Dir or Link is set; a
+	// nil Data with neither set makes an empty regular file.
+	Data []byte
+	// Link, if non-empty, is the target path name and makes this entry a
+	// link. Data and Dir are ignored when Link is set.
+	Link string
+	// Dir marks the entry as a directory. Directories with children do
+	// not need Dir set: they are created implicitly.
+	Dir bool
+	// ModTime is the entry's modification time. The zero value means the
+	// time NewClient is called.
+	ModTime time.Time
+}
+
+// entry is a node in the in-memory tree: both its DirEntry and, for regular
+// files, its content.
+type entry struct {
+	de   upspin.DirEntry
+	data []byte
+}
+
+// Client is an in-memory implementation of upspin.Client. The zero value is
+// an empty tree with no users; use NewClient to seed it with entries.
+type Client struct {
+	mu   sync.Mutex
+	seq  int64
+	tree map[upspin.PathName]*entry
+}
+
+var _ upspin.Client = (*Client)(nil)
+
+// NewClient returns a Client populated with files. Keys are full Upspin path
+// names, such as "user@example.com/documents/doc1.txt".
+func NewClient(files map[string]File) *Client {
+	c := &Client{tree: make(map[upspin.PathName]*entry)}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	// Create shorter paths, i.e. directories, before the files they
+	// contain so ensureParentsLocked always finds an already-seeded
+	// ancestor when one was given explicitly with Dir: true.
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := files[name]
+		pn := upspin.PathName(name)
+		c.ensureParentsLocked(pn)
+		switch {
+		case f.Link != "":
+			c.setLocked(pn, upspin.AttrLink, upspin.PathName(f.Link), nil, f.ModTime)
+		case f.Dir:
+			c.setLocked(pn, upspin.AttrDirectory, "", nil, f.ModTime)
+		default:
+			c.setLocked(pn, upspin.AttrNone, "", f.Data, f.ModTime)
+		}
+	}
+	return c
+}
+
+// ensureParentsLocked creates AttrDirectory entries for every ancestor of
+// name that does not already exist.
+func (c *Client) ensureParentsLocked(name upspin.PathName) {
+	p, err := path.Parse(name)
+	if err != nil {
+		return
+	}
+	for i := 0; i < p.NElem(); i++ {
+		dir := trimSlash(p.First(i).Path())
+		if _, ok := c.tree[dir]; !ok {
+			c.setLocked(dir, upspin.AttrDirectory, "", nil, time.Time{})
+		}
+	}
+}
+
+// trimSlash drops the trailing slash Parsed.First(0) leaves on a bare user
+// root, so root paths are keyed the same way whether they come from First
+// or from a literal string such as "user@example.com".
+func trimSlash(pn upspin.PathName) upspin.PathName {
+	s := string(pn)
+	if len(s) > 0 && s[len(s)-1] == '/' {
+		return upspin.PathName(s[:len(s)-1])
+	}
+	return pn
+}
+
+// setLocked inserts or overwrites the entry at name and returns its new
+// DirEntry. The caller must hold c.mu.
+func (c *Client) setLocked(name upspin.PathName, attr upspin.Attribute, link upspin.PathName, data []byte, modTime time.Time) *upspin.DirEntry {
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+	c.seq++
+	de := upspin.DirEntry{
+		Name:     name,
+		Attr:     attr,
+		Link:     link,
+		Time:     upspin.TimeFromGo(modTime),
+		Sequence: c.seq,
+	}
+	if attr == upspin.AttrNone {
+		de.Blocks = []upspin.DirBlock{{Size: int64(len(data))}}
+	}
+	if c.tree == nil {
+		c.tree = make(map[upspin.PathName]*entry)
+	}
+	c.tree[name] = &entry{de: de, data: data}
+	return &de
+}
+
+// maxLinkHops bounds link resolution so a link cycle fails instead of
+// recursing forever.
+const maxLinkHops = 32
+
+// resolveLocked walks name from its root, following links in every
+// intermediate path element and, if followFinal is set, the final element
+// too. The caller must hold c.mu.
+func (c *Client) resolveLocked(name upspin.PathName, followFinal bool) (*entry, error) {
+	return c.resolveDepthLocked(name, followFinal, 0)
+}
+
+func (c *Client) resolveDepthLocked(name upspin.PathName, followFinal bool, depth int) (*entry, error) {
+	if depth > maxLinkHops {
+		return nil, errors.E(errors.Other, name, errors.Str("upspintest: too many links"))
+	}
+
+	elems := strings.Split(string(name), "/")
+	cur := upspin.PathName(elems[0])
+	e, ok := c.tree[cur]
+	if !ok {
+		return nil, errors.E(errors.NotExist, name)
+	}
+
+	for i := 1; i < len(elems); i++ {
+		cur = upspin.PathName(string(cur) + "/" + elems[i])
+		e, ok = c.tree[cur]
+		if !ok {
+			return nil, errors.E(errors.NotExist, name)
+		}
+
+		last := i == len(elems)-1
+		if e.de.IsLink() && (!last || followFinal) {
+			target, err := c.resolveDepthLocked(e.de.Link, true, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			cur = target.de.Name
+			e = target
+		}
+	}
+	return e, nil
+}
+
+// childrenLocked returns the direct children of parent. The caller must
+// hold c.mu.
+func (c *Client) childrenLocked(parent upspin.PathName) []upspin.PathName {
+	prefix := string(parent) + "/"
+	var children []upspin.PathName
+	for name := range c.tree {
+		s := string(name)
+		if !strings.HasPrefix(s, prefix) {
+			continue
+		}
+		if strings.Contains(s[len(prefix):], "/") {
+			continue
+		}
+		children = append(children, name)
+	}
+	return children
+}
+
+// baseName returns the last path element of name.
+func baseName(name upspin.PathName) string {
+	i := strings.LastIndexByte(string(name), '/')
+	if i < 0 {
+		return string(name)
+	}
+	return string(name[i+1:])
+}
+
+// incomplete returns the incomplete DirEntry a successful mutation reports:
+// one that carries only the new sequence number, per the upspin.Client
+// documentation.
+func incomplete(de *upspin.DirEntry) *upspin.DirEntry {
+	out := &upspin.DirEntry{Sequence: de.Sequence}
+	out.MarkIncomplete()
+	return out
+}
+
+func (c *Client) Get(name upspin.PathName) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := c.resolveLocked(name, true)
+	if err != nil {
+		return nil, err
+	}
+	if e.de.IsDir() {
+		return nil, errors.E(errors.IsDir, name)
+	}
+	out := make([]byte, len(e.data))
+	copy(out, e.data)
+	return out, nil
+}
+
+func (c *Client) Lookup(name upspin.PathName, followFinal bool) (*upspin.DirEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := c.resolveLocked(name, followFinal)
+	if err != nil {
+		return nil, err
+	}
+	return e.de.Copy(), nil
+}
+
+func (c *Client) Put(name upspin.PathName, data []byte) (*upspin.DirEntry, error) {
+	return c.PutSequenced(name, upspin.SeqIgnore, data)
+}
+
+func (c *Client) PutSequenced(name upspin.PathName, seq int64, data []byte) (*upspin.DirEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, ok := c.tree[name]; ok {
+		if existing.de.IsDir() {
+			return nil, errors.E(errors.IsDir, name)
+		}
+		switch seq {
+		case upspin.SeqIgnore:
+		case upspin.SeqNotExist:
+			return nil, errors.E(errors.Exist, name)
+		default:
+			if existing.de.Sequence != seq {
+				return nil, errors.E(errors.Invalid, name, errors.Str("upspintest: sequence mismatch"))
+			}
+		}
+	} else if seq > upspin.SeqIgnore {
+		return nil, errors.E(errors.NotExist, name)
+	}
+
+	c.ensureParentsLocked(name)
+	de := c.setLocked(name, upspin.AttrNone, "", data, time.Time{})
+	return incomplete(de), nil
+}
+
+func (c *Client) PutLink(oldName, newName upspin.PathName) (*upspin.DirEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ensureParentsLocked(newName)
+	de := c.setLocked(newName, upspin.AttrLink, oldName, nil, time.Time{})
+	return incomplete(de), nil
+}
+
+func (c *Client) PutDuplicate(oldName, newName upspin.PathName) (*upspin.DirEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.tree[newName]; ok {
+		return nil, errors.E(errors.Exist, newName)
+	}
+	old, err := c.resolveLocked(oldName, false)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ensureParentsLocked(newName)
+	de := c.setLocked(newName, old.de.Attr, old.de.Link, old.data, time.Time{})
+	return incomplete(de), nil
+}
+
+func (c *Client) MakeDirectory(dirName upspin.PathName) (*upspin.DirEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.tree[dirName]; ok {
+		return nil, errors.E(errors.Exist, dirName)
+	}
+
+	p, err := path.Parse(dirName)
+	if err != nil {
+		return nil, err
+	}
+	if n := p.NElem(); n > 0 {
+		parent, err := c.resolveLocked(trimSlash(p.First(n-1).Path()), true)
+		if err != nil {
+			return nil, err
+		}
+		if !parent.de.IsDir() {
+			return nil, errors.E(errors.NotDir, dirName)
+		}
+	}
+
+	de := c.setLocked(dirName, upspin.AttrDirectory, "", nil, time.Time{})
+	return incomplete(de), nil
+}
+
+func (c *Client) Rename(oldName, newName upspin.PathName) (*upspin.DirEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.tree[newName]; ok {
+		return nil, errors.E(errors.Exist, newName)
+	}
+	old, ok := c.tree[oldName]
+	if !ok {
+		return nil, errors.E(errors.NotExist, oldName)
+	}
+
+	delete(c.tree, oldName)
+	de := c.setLocked(newName, old.de.Attr, old.de.Link, old.data, old.de.Time.Go())
+	return incomplete(de), nil
+}
+
+func (c *Client) SetTime(name upspin.PathName, t upspin.Time) error {
+	_, err := c.SetTimeSequenced(name, upspin.SeqIgnore, t)
+	return err
+}
+
+func (c *Client) SetTimeSequenced(name upspin.PathName, seq int64, t upspin.Time) (*upspin.DirEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.tree[name]
+	if !ok {
+		return nil, errors.E(errors.NotExist, name)
+	}
+	if seq != upspin.SeqIgnore && e.de.Sequence != seq {
+		return nil, errors.E(errors.Invalid, name, errors.Str("upspintest: sequence mismatch"))
+	}
+	e.de.Time = t
+	c.seq++
+	e.de.Sequence = c.seq
+	return incomplete(&e.de), nil
+}
+
+func (c *Client) Delete(name upspin.PathName) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := c.resolveLocked(name, false)
+	if err != nil {
+		return err
+	}
+	if e.de.IsDir() && len(c.childrenLocked(e.de.Name)) > 0 {
+		return errors.E(errors.NotEmpty, name)
+	}
+	delete(c.tree, e.de.Name)
+	return nil
+}
+
+func (c *Client) Glob(pattern string) ([]*upspin.DirEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elems := strings.Split(pattern, "/")
+	matches := []upspin.PathName{upspin.PathName(elems[0])}
+	for _, elem := range elems[1:] {
+		var next []upspin.PathName
+		for _, m := range matches {
+			for _, child := range c.childrenLocked(m) {
+				ok, err := stdpath.Match(elem, baseName(child))
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					next = append(next, child)
+				}
+			}
+		}
+		matches = next
+	}
+
+	des := make([]*upspin.DirEntry, 0, len(matches))
+	for _, m := range matches {
+		if e, ok := c.tree[m]; ok {
+			des = append(des, e.de.Copy())
+		}
+	}
+	upspin.SortDirEntries(des, true)
+	return des, nil
+}
+
+func (c *Client) Create(name upspin.PathName) (upspin.File, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, err := path.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+	if n := p.NElem(); n > 0 {
+		parent, err := c.resolveLocked(trimSlash(p.First(n-1).Path()), true)
+		if err != nil {
+			return nil, err
+		}
+		if !parent.de.IsDir() {
+			return nil, errors.E(errors.NotDir, name)
+		}
+	}
+
+	return &memFile{c: c, name: name, writable: true}, nil
+}
+
+func (c *Client) Open(name upspin.PathName) (upspin.File, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := c.resolveLocked(name, true)
+	if err != nil {
+		return nil, err
+	}
+	if e.de.IsDir() {
+		return nil, errors.E(errors.IsDir, name)
+	}
+	data := make([]byte, len(e.data))
+	copy(data, e.data)
+	return &memFile{c: c, name: e.de.Name, data: data}, nil
+}
+
+func (c *Client) DirServer(name upspin.PathName) (upspin.DirServer, error) {
+	return nil, errors.E(errors.Invalid, name, errors.Str("upspintest: DirServer not implemented"))
+}
+
+// memFile implements upspin.File over an in-memory byte slice. Like the
+// real Upspin client, a writable memFile only reaches the Client's tree on
+// Close.
+type memFile struct {
+	c        *Client
+	name     upspin.PathName
+	data     []byte
+	offset   int64
+	writable bool
+	closed   bool
+
+	// lastReadAt is bumped, unsynchronized, on every ReadAt call. Real
+	// upspin.File implementations keep internal state of their own and are
+	// not safe for concurrent use; this field exists so that two
+	// goroutines calling ReadAt on the same memFile race under `go test
+	// -race`, the way they would against a real client.
+	lastReadAt int64
+}
+
+var _ upspin.File = (*memFile)(nil)
+
+func (f *memFile) Name() upspin.PathName { return f.name }
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return errors.E(errors.Invalid, f.name, errors.Str("upspintest: file already closed"))
+	}
+	f.closed = true
+	if !f.writable {
+		return nil
+	}
+	f.c.mu.Lock()
+	defer f.c.mu.Unlock()
+	f.c.ensureParentsLocked(f.name)
+	f.c.setLocked(f.name, upspin.AttrNone, "", f.data, time.Time{})
+	return nil
+}
+
+func (f *memFile) Read(b []byte) (int, error) {
+	n, err := f.ReadAt(b, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) ReadAt(b []byte, off int64) (int, error) {
+	if f.writable {
+		// Mirrors upspin.io/client: a File returned by Create is
+		// write-only until it is Closed and reopened with Open.
+		return 0, errors.E(errors.Invalid, f.name, errors.Str("upspintest: invalid operation: not open for read"))
+	}
+	f.lastReadAt = off
+	if off < 0 {
+		return 0, errors.E(errors.Invalid, f.name, errors.Str("upspintest: negative offset"))
+	}
+	if off >= int64(len(f.data)) {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n := copy(b, f.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(b []byte) (int, error) {
+	n, err := f.WriteAt(b, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(b []byte, off int64) (int, error) {
+	if !f.writable {
+		return 0, errors.E(errors.Permission, f.name, errors.Str("upspintest: file not opened for writing"))
+	}
+	if off < 0 {
+		return 0, errors.E(errors.Invalid, f.name, errors.Str("upspintest: negative offset"))
+	}
+	end := off + int64(len(b))
+	if end > int64(len(f.data)) {
+		grown := make([]byte, end)
+		copy(grown, f.data)
+		f.data = grown
+	}
+	copy(f.data[off:], b)
+	return len(b), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = f.offset + offset
+	case io.SeekEnd:
+		abs = int64(len(f.data)) + offset
+	default:
+		return 0, errors.E(errors.Invalid, f.name, errors.Str("upspintest: invalid whence"))
+	}
+	if abs < 0 {
+		return 0, errors.E(errors.Invalid, f.name, errors.Str("upspintest: negative position"))
+	}
+	f.offset = abs
+	return abs, nil
+}
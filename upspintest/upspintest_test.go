@@ -0,0 +1,94 @@
+package upspintest_test
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/rschio/upspinfsys"
+	"github.com/rschio/upspinfsys/upspintest"
+	"upspin.io/upspin"
+)
+
+const root = "user@example.com"
+
+func newTestClient() upspin.Client {
+	return upspintest.NewClient(map[string]upspintest.File{
+		root + "/rootfile.txt":        {Data: []byte("rootfile")},
+		root + "/documents/doc1.txt":  {Data: []byte("doc1")},
+		root + "/documents/doc2.txt":  {Data: []byte("doc2")},
+		root + "/documents/link_text": {Link: root + "/documents/doc1.txt"},
+		root + "/code":                {Dir: true},
+		root + "/code/main.go":        {Data: []byte("package main")},
+	})
+}
+
+func TestFS(t *testing.T) {
+	c := newTestClient()
+
+	expected := []string{
+		filepath.Join(root, "rootfile.txt"),
+		filepath.Join(root, "documents"),
+		filepath.Join(root, "documents", "doc1.txt"),
+		filepath.Join(root, "documents", "doc2.txt"),
+		filepath.Join(root, "documents", "link_text"),
+		filepath.Join(root, "code"),
+		filepath.Join(root, "code", "main.go"),
+	}
+	upspintest.TestFS(t, c, expected...)
+}
+
+func TestClientLink(t *testing.T) {
+	c := newTestClient()
+	fsys := upspinfsys.UpspinFS(c)
+
+	target, err := fsys.Open(filepath.Join(root, "documents", "doc1.txt"))
+	if err != nil {
+		t.Fatalf("Open target: %v", err)
+	}
+	want, err := io.ReadAll(target)
+	target.Close()
+	if err != nil {
+		t.Fatalf("ReadAll target: %v", err)
+	}
+
+	link, err := fsys.Open(filepath.Join(root, "documents", "link_text"))
+	if err != nil {
+		t.Fatalf("Open link: %v", err)
+	}
+	got, err := io.ReadAll(link)
+	link.Close()
+	if err != nil {
+		t.Fatalf("ReadAll link: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %s want %s", got, want)
+	}
+}
+
+func TestClientWriteFS(t *testing.T) {
+	c := newTestClient()
+	wfs := upspinfsys.UpspinWriteFS(c)
+
+	name := filepath.Join(root, "newfile.txt")
+	f, err := wfs.Create(name)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := io.WriteString(f.(io.Writer), "hello"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, err := fs.ReadFile(upspinfsys.UpspinFS(c), name)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("got %q want %q", got, "hello")
+	}
+}
@@ -0,0 +1,303 @@
+package upspinfsys
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"upspin.io/errors"
+	"upspin.io/path"
+	"upspin.io/upspin"
+)
+
+// WriteFS extends fs.FS with the operations needed to create, modify, and
+// remove files and directories in an Upspin tree. The method set mirrors
+// afero.Fs (github.com/spf13/afero) so that an Upspin tree can be dropped in
+// wherever a read-write VFS is expected; see the upspinafero package for an
+// adapter that does exactly that.
+type WriteFS interface {
+	fs.FS
+
+	// OpenFile opens the named file using the given flags (os.O_RDONLY,
+	// os.O_WRONLY, os.O_RDWR, os.O_CREATE, os.O_EXCL, os.O_TRUNC,
+	// os.O_APPEND) and perm. perm is accepted for symmetry with os.OpenFile
+	// but is currently unused: Upspin permissions come from the nearest
+	// Access file, not from per-file mode bits.
+	OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error)
+
+	// Create is equivalent to OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666).
+	Create(name string) (fs.File, error)
+
+	// Mkdir creates a directory. Its parent must already exist.
+	Mkdir(name string, perm fs.FileMode) error
+
+	// MkdirAll creates name and any missing parents, like os.MkdirAll.
+	MkdirAll(name string, perm fs.FileMode) error
+
+	// Remove removes the named file or empty directory.
+	Remove(name string) error
+
+	// RemoveAll removes name and, if it is a directory, everything it
+	// contains. It does not fail if name does not exist.
+	RemoveAll(name string) error
+
+	// Rename renames (moves) oldname to newname.
+	Rename(oldname, newname string) error
+}
+
+// UpspinWriteFS returns a WriteFS backed by c. Unlike UpspinFS, the returned
+// filesystem can create, modify, and delete entries in the Upspin tree.
+//
+// Since Upspin's Put replaces an object wholesale, writes made through the
+// files it returns are buffered in memory and only reach the StoreServer
+// when the file is Closed.
+func UpspinWriteFS(c upspin.Client) WriteFS {
+	return uFS{client: c}
+}
+
+func (u uFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	const op = "openfile"
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_APPEND|os.O_TRUNC) == 0 {
+		return u.Open(name)
+	}
+
+	pn := upspin.PathName(name)
+	de, err := u.client.Lookup(pn, true)
+	exists := err == nil
+	if err != nil && !errors.Is(errors.NotExist, err) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: translateErr(err, "lookup")}
+	}
+
+	switch {
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	case exists && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+	case exists && de.IsDir():
+		return nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("%s: is a directory", name)}
+	}
+
+	var data []byte
+	if exists && flag&os.O_TRUNC == 0 {
+		data, err = u.client.Get(pn)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: translateErr(err, "get")}
+		}
+	}
+
+	wf := &writeFile{client: u.client, name: pn, data: data}
+	if flag&os.O_APPEND != 0 {
+		wf.pos = int64(len(data))
+	}
+	return wf, nil
+}
+
+func (u uFS) Create(name string) (fs.File, error) {
+	return u.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (u uFS) Mkdir(name string, perm fs.FileMode) error {
+	const op = "mkdir"
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if _, err := u.client.MakeDirectory(upspin.PathName(name)); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: translateErr(err, "mkdir")}
+	}
+	return nil
+}
+
+func (u uFS) MkdirAll(name string, perm fs.FileMode) error {
+	const op = "mkdirall"
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	p, err := path.Parse(upspin.PathName(name))
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	for i := 0; i <= p.NElem(); i++ {
+		dir := p.First(i).Path()
+		de, err := u.client.Lookup(dir, true)
+		switch {
+		case err == nil && de.IsDir():
+			continue
+		case err == nil:
+			return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("%s: not a directory", dir)}
+		}
+		if _, err := u.client.MakeDirectory(dir); err != nil {
+			return &fs.PathError{Op: op, Path: name, Err: translateErr(err, "mkdir")}
+		}
+	}
+	return nil
+}
+
+func (u uFS) Remove(name string) error {
+	const op = "remove"
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if err := u.client.Delete(upspin.PathName(name)); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: translateErr(err, "delete")}
+	}
+	return nil
+}
+
+func (u uFS) RemoveAll(name string) error {
+	const op = "removeall"
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	pn := upspin.PathName(name)
+	de, err := u.client.Lookup(pn, true)
+	if err != nil {
+		if errors.Is(errors.NotExist, err) {
+			return nil
+		}
+		return &fs.PathError{Op: op, Path: name, Err: translateErr(err, "lookup")}
+	}
+
+	if de.IsDir() {
+		entries, err := u.ReadDir(name)
+		if err != nil {
+			return &fs.PathError{Op: op, Path: name, Err: err}
+		}
+		for _, e := range entries {
+			child := string(path.Join(pn, e.Name()))
+			if err := u.RemoveAll(child); err != nil {
+				return err
+			}
+		}
+	}
+	return u.Remove(name)
+}
+
+func (u uFS) Rename(oldname, newname string) error {
+	const op = "rename"
+	if !fs.ValidPath(oldname) {
+		return &fs.PathError{Op: op, Path: oldname, Err: fs.ErrInvalid}
+	}
+	if !fs.ValidPath(newname) {
+		return &fs.PathError{Op: op, Path: newname, Err: fs.ErrInvalid}
+	}
+	if _, err := u.client.Rename(upspin.PathName(oldname), upspin.PathName(newname)); err != nil {
+		return &fs.PathError{Op: op, Path: oldname, Err: translateErr(err, "rename")}
+	}
+	return nil
+}
+
+// writeFile buffers a file's entire contents in memory while it is open.
+// This is necessary, not just convenient: upspin.io/client only ever opens
+// files write-only for writing (client.Create), so Read/ReadAt against the
+// underlying upspin.File always fail once anything has been written to it.
+// Keeping the buffer here instead lets writeFile support read-modify-write
+// access patterns (os.O_RDWR without os.O_TRUNC). The buffer is written out
+// with a single client.Create/Write/Close sequence when writeFile itself is
+// Closed.
+type writeFile struct {
+	client upspin.Client
+	name   upspin.PathName
+	data   []byte
+	pos    int64
+	closed bool
+}
+
+func (f *writeFile) Close() error {
+	const op = "close"
+	if f.closed {
+		return &fs.PathError{Op: op, Path: string(f.name), Err: fs.ErrInvalid}
+	}
+	f.closed = true
+
+	wf, err := f.client.Create(f.name)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: string(f.name), Err: translateErr(err, "create")}
+	}
+	if _, err := wf.Write(f.data); err != nil {
+		wf.Close()
+		return &fs.PathError{Op: op, Path: string(f.name), Err: err}
+	}
+	if err := wf.Close(); err != nil {
+		return &fs.PathError{Op: op, Path: string(f.name), Err: translateErr(err, "close")}
+	}
+	return nil
+}
+
+func (f *writeFile) Read(b []byte) (n int, err error) {
+	n, err = f.ReadAt(b, f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *writeFile) ReadAt(b []byte, off int64) (n int, err error) {
+	const op = "read"
+	if off < 0 {
+		return 0, &fs.PathError{Op: op, Path: string(f.name), Err: fs.ErrInvalid}
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n = copy(b, f.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *writeFile) Write(b []byte) (n int, err error) {
+	n, err = f.WriteAt(b, f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *writeFile) WriteAt(b []byte, off int64) (n int, err error) {
+	const op = "write"
+	if off < 0 {
+		return 0, &fs.PathError{Op: op, Path: string(f.name), Err: fs.ErrInvalid}
+	}
+	end := off + int64(len(b))
+	if end > int64(len(f.data)) {
+		grown := make([]byte, end)
+		copy(grown, f.data)
+		f.data = grown
+	}
+	return copy(f.data[off:end], b), nil
+}
+
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	const op = "seek"
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = f.pos + offset
+	case io.SeekEnd:
+		abs = int64(len(f.data)) + offset
+	default:
+		return 0, &fs.PathError{Op: op, Path: string(f.name), Err: fs.ErrInvalid}
+	}
+	if abs < 0 {
+		return 0, &fs.PathError{Op: op, Path: string(f.name), Err: fs.ErrInvalid}
+	}
+	f.pos = abs
+	return abs, nil
+}
+
+func (f *writeFile) Stat() (fs.FileInfo, error) {
+	return info{
+		name:    baseName(f.name),
+		size:    int64(len(f.data)),
+		mode:    0600,
+		modTime: upspin.Now().Go(),
+	}, nil
+}
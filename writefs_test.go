@@ -0,0 +1,143 @@
+package upspinfsys_test
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rschio/upspinfsys"
+	"github.com/rschio/upspinfsys/upspintest"
+	"upspin.io/upspin"
+)
+
+func TestOpenFileCreate(t *testing.T) {
+	wfs := upspinfsys.UpspinWriteFS(c)
+	root := string(cfg.UserName())
+	name := filepath.Join(root, "newfile.txt")
+
+	f, err := wfs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if _, err := io.WriteString(f.(io.Writer), "hello"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, err := fs.ReadFile(upspinfsys.UpspinFS(c), name)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("got %q want %q", got, "hello")
+	}
+
+	if _, err := wfs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); !os.IsExist(err) {
+		t.Fatalf("OpenFile with O_EXCL on existing file: got %v, want fs.ErrExist", err)
+	}
+}
+
+func TestOpenFileAppend(t *testing.T) {
+	wfs := upspinfsys.UpspinWriteFS(c)
+	root := string(cfg.UserName())
+	name := filepath.Join(root, "appendfile.txt")
+
+	if _, err := c.Put(upspin.PathName(name), []byte("doc1")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	f, err := wfs.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if _, err := io.WriteString(f.(io.Writer), "-appended"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, err := fs.ReadFile(upspinfsys.UpspinFS(c), name)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if want := "doc1-appended"; string(got) != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+// TestOpenFileReadWrite guards against a regression where OpenFile's
+// read-modify-write path delegated Read/ReadAt to the underlying
+// upspin.File: a File returned by client.Create is write-only, so those
+// calls always failed against a real Upspin client once anything had been
+// written to it. upspintest's fake Client rejects ReadAt on a File returned
+// by Create in the same way, so this test catches that regression.
+func TestOpenFileReadWrite(t *testing.T) {
+	const name = "user@example.com/rw.txt"
+	client := upspintest.NewClient(map[string]upspintest.File{
+		name: {Data: []byte("hello world")},
+	})
+	wfs := upspinfsys.UpspinWriteFS(client)
+
+	f, err := wfs.OpenFile(name, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+
+	buf := make([]byte, 5)
+	if _, err := f.(io.Reader).Read(buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("got %q want %q", buf, "hello")
+	}
+
+	if _, err := f.(io.WriterAt).WriteAt([]byte("HELLO"), 0); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, err := fs.ReadFile(upspinfsys.UpspinFS(client), name)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if want := "HELLO world"; string(got) != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestMkdirRemoveRename(t *testing.T) {
+	wfs := upspinfsys.UpspinWriteFS(c)
+	root := string(cfg.UserName())
+	dir := filepath.Join(root, "scratch", "sub")
+
+	if err := wfs.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	f, err := wfs.Create(filepath.Join(dir, "a.txt"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	renamed := filepath.Join(dir, "b.txt")
+	if err := wfs.Rename(filepath.Join(dir, "a.txt"), renamed); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+
+	if err := wfs.RemoveAll(filepath.Join(root, "scratch")); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+
+	if _, err := upspinfsys.UpspinFS(c).Open(renamed); !os.IsNotExist(err) {
+		t.Fatalf("Open after RemoveAll: got %v, want fs.ErrNotExist", err)
+	}
+}